@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/asim/mq/go/envelope"
+)
+
+// defaultAckTimeout is how long an ack-mode delivery waits for
+// acknowledgement before being redelivered.
+const defaultAckTimeout = 30 * time.Second
+
+// maxOutstandingAcks bounds how many unacked deliveries a single ack-mode
+// subscriber may accumulate before it is disconnected, to keep a stalled
+// subscriber from growing the pending set without limit.
+const maxOutstandingAcks = 1000
+
+type ackFrameType byte
+
+const (
+	ackFrame  ackFrameType = 'A'
+	nackFrame ackFrameType = 'N'
+)
+
+// encodeAckEnvelope frames a seq-numbered delivery: an 8-byte big-endian
+// sequence number followed by the usual topic-framed envelope.
+func encodeAckEnvelope(seq uint64, topic string, payload []byte) []byte {
+	env := envelope.Encode(topic, payload)
+	buf := make([]byte, 8+len(env))
+	binary.BigEndian.PutUint64(buf[0:8], seq)
+	copy(buf[8:], env)
+	return buf
+}
+
+// encodeAckControl frames a client->server ack or nack control message: a
+// single type byte followed by the 8-byte sequence number it refers to.
+func encodeAckControl(t ackFrameType, seq uint64) []byte {
+	buf := make([]byte, 9)
+	buf[0] = byte(t)
+	binary.BigEndian.PutUint64(buf[1:9], seq)
+	return buf
+}
+
+// decodeAckControl reverses encodeAckControl.
+func decodeAckControl(b []byte) (t ackFrameType, seq uint64, err error) {
+	if len(b) != 9 {
+		return 0, 0, errors.New("ack control frame malformed")
+	}
+	return ackFrameType(b[0]), binary.BigEndian.Uint64(b[1:9]), nil
+}
+
+// pendingAck is one unacknowledged ack-mode delivery.
+type pendingAck struct {
+	delivery *delivery
+	sentAt   time.Time
+}
+
+// ackRedelivery is a pending delivery that's gone unacked longer than its
+// tracker's timeout and needs to be resent.
+type ackRedelivery struct {
+	seq      uint64
+	delivery *delivery
+}
+
+// ackTracker assigns sequence numbers to an ack-mode subscriber's
+// deliveries and tracks which are still outstanding, redelivering any that
+// go unacked for longer than timeout. A tracker is scoped to a single
+// subscriber connection; two subscribers on the same topic each get their
+// own, so their sequence numbers and redeliveries never interleave.
+//
+// When useStorageSeq is set, track uses a delivery's storage ID as its seq
+// instead of a connection-local counter, so seqs line up with the message
+// IDs storage.Replay understands; a reconnecting subscriber's resume then
+// means the same thing as offset. This is only safe for an exact topic
+// backed by storage: storage IDs are per-topic, so a pattern subscriber
+// spanning several topics could otherwise see the same seq twice.
+type ackTracker struct {
+	timeout       time.Duration
+	useStorageSeq bool
+
+	sync.Mutex
+	nextSeq uint64
+	pending map[uint64]*pendingAck
+}
+
+func newAckTracker(timeout time.Duration, useStorageSeq bool) *ackTracker {
+	if timeout <= 0 {
+		timeout = defaultAckTimeout
+	}
+	return &ackTracker{timeout: timeout, useStorageSeq: useStorageSeq, pending: make(map[uint64]*pendingAck)}
+}
+
+// track assigns d a sequence number and records it as outstanding.
+// overflow reports whether doing so pushed the tracker past
+// maxOutstandingAcks, in which case the caller should disconnect the
+// subscriber rather than let unacked state grow without bound.
+func (a *ackTracker) track(d *delivery) (seq uint64, overflow bool) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.useStorageSeq && d.hasID {
+		seq = d.storageID
+	} else {
+		a.nextSeq++
+		seq = a.nextSeq
+	}
+	a.pending[seq] = &pendingAck{delivery: d, sentAt: time.Now()}
+	return seq, len(a.pending) > maxOutstandingAcks
+}
+
+// ack removes seq from the outstanding set.
+func (a *ackTracker) ack(seq uint64) {
+	a.Lock()
+	delete(a.pending, seq)
+	a.Unlock()
+}
+
+// nack marks seq overdue so the next due() call redelivers it immediately
+// instead of waiting out the rest of its timeout.
+func (a *ackTracker) nack(seq uint64) {
+	a.Lock()
+	if p, ok := a.pending[seq]; ok {
+		p.sentAt = time.Time{}
+	}
+	a.Unlock()
+}
+
+// due returns deliveries that have been outstanding longer than timeout,
+// refreshing their sentAt so they aren't returned again until the next
+// timeout elapses.
+func (a *ackTracker) due() []ackRedelivery {
+	a.Lock()
+	defer a.Unlock()
+
+	now := time.Now()
+	var out []ackRedelivery
+	for seq, p := range a.pending {
+		if now.Sub(p.sentAt) >= a.timeout {
+			p.sentAt = now
+			out = append(out, ackRedelivery{seq: seq, delivery: p.delivery})
+		}
+	}
+	return out
+}
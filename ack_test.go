@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/asim/mq/go/envelope"
+)
+
+func TestAckEnvelopeRoundTrip(t *testing.T) {
+	b := encodeAckEnvelope(7, "foo.bar", []byte("hello"))
+
+	typ, seq, err := decodeAckControl(encodeAckControl(ackFrame, 7))
+	if err != nil {
+		t.Fatalf("decodeAckControl: %v", err)
+	}
+	if typ != ackFrame || seq != 7 {
+		t.Errorf("got (%v, %d), want (%v, 7)", typ, seq, ackFrame)
+	}
+
+	if len(b) < 8 {
+		t.Fatalf("ack envelope too short: %d bytes", len(b))
+	}
+	if got := binary.BigEndian.Uint64(b[0:8]); got != 7 {
+		t.Errorf("envelope seq = %d, want 7", got)
+	}
+	topic, payload, err := envelope.Decode(b[8:])
+	if err != nil {
+		t.Fatalf("envelope.Decode: %v", err)
+	}
+	if topic != "foo.bar" || string(payload) != "hello" {
+		t.Errorf("envelope = (%q, %q), want (\"foo.bar\", \"hello\")", topic, payload)
+	}
+}
+
+func TestDecodeAckControlErrors(t *testing.T) {
+	if _, _, err := decodeAckControl([]byte{1, 2, 3}); err == nil {
+		t.Error("expected error for malformed ack control frame")
+	}
+}
+
+func TestAckTrackerTrackAckDue(t *testing.T) {
+	tr := newAckTracker(10*time.Millisecond, false)
+
+	seq, overflow := tr.track(&delivery{topic: "foo", payload: []byte("1")})
+	if overflow {
+		t.Fatal("unexpected overflow on first track")
+	}
+	if seq != 1 {
+		t.Fatalf("seq = %d, want 1", seq)
+	}
+
+	if due := tr.due(); len(due) != 0 {
+		t.Fatalf("expected nothing due yet, got %d", len(due))
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	due := tr.due()
+	if len(due) != 1 || due[0].seq != seq {
+		t.Fatalf("due = %+v, want redelivery of seq %d", due, seq)
+	}
+
+	tr.ack(seq)
+	if due := tr.due(); len(due) != 0 {
+		t.Fatalf("expected nothing due after ack, got %d", len(due))
+	}
+}
+
+func TestAckTrackerNackForcesRedelivery(t *testing.T) {
+	tr := newAckTracker(time.Hour, false)
+
+	seq, _ := tr.track(&delivery{topic: "foo", payload: []byte("1")})
+	tr.nack(seq)
+
+	due := tr.due()
+	if len(due) != 1 || due[0].seq != seq {
+		t.Fatalf("due = %+v, want immediate redelivery of seq %d", due, seq)
+	}
+}
+
+func TestAckTrackerOverflow(t *testing.T) {
+	tr := newAckTracker(time.Hour, false)
+
+	var overflowed bool
+	for i := 0; i < maxOutstandingAcks+1; i++ {
+		_, overflowed = tr.track(&delivery{topic: "foo", payload: []byte("x")})
+	}
+	if !overflowed {
+		t.Error("expected overflow once pending exceeds maxOutstandingAcks")
+	}
+}
+
+func TestAckTrackerStorageSeq(t *testing.T) {
+	tr := newAckTracker(time.Hour, true)
+
+	seq, overflow := tr.track(&delivery{topic: "foo", payload: []byte("1"), storageID: 42, hasID: true})
+	if overflow {
+		t.Fatal("unexpected overflow on first track")
+	}
+	if seq != 42 {
+		t.Fatalf("seq = %d, want the delivery's storage ID 42", seq)
+	}
+
+	// A delivery without a storage ID (e.g. an inbox message) still falls
+	// back to the connection-local counter.
+	seq2, _ := tr.track(&delivery{topic: "foo", payload: []byte("2")})
+	if seq2 != 1 {
+		t.Fatalf("seq = %d, want 1 for a delivery with no storage ID", seq2)
+	}
+}
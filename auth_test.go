@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestFileACLAuthorize(t *testing.T) {
+	a := &fileACL{tokens: map[string]ACL{
+		"tok": {
+			Pub:   []string{"orders.*"},
+			Sub:   []string{"foo.*"},
+			Stats: true,
+		},
+		"no-stats": {
+			Sub: []string{"foo.*"},
+		},
+	}}
+
+	cases := []struct {
+		token, action, topic string
+		want                 bool
+	}{
+		{"tok", "pub", "orders.created", true},
+		{"tok", "pub", "orders.created.extra", false},
+		{"tok", "sub", "foo.bar", true},
+		{"tok", "sub", "other.bar", false},
+		// A subscribe pattern must itself be fully contained in the
+		// ACL pattern, not merely share a common prefix: foo.* only
+		// ever grants a single token, so it can't authorize the
+		// broader foo.#.
+		{"tok", "sub", "foo.#", false},
+		{"tok", "stats", "", true},
+		{"no-stats", "stats", "", false},
+		{"unknown-token", "sub", "foo.bar", false},
+	}
+
+	for _, c := range cases {
+		if got := a.Authorize(c.token, c.action, c.topic); got != c.want {
+			t.Errorf("Authorize(%q, %q, %q) = %v, want %v", c.token, c.action, c.topic, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package broker defines the transport-agnostic interface the mq server
+// and client run on top of, plus the pluggable backends that implement
+// it: the default HTTP/WS transport, NATS, and Redis.
+package broker
+
+import "fmt"
+
+// Handler processes a message delivered to a subscribed topic. topic is
+// the concrete topic the message arrived on, which may differ from the
+// subscribed topic when it was a pattern.
+type Handler func(topic string, payload []byte)
+
+// Subscriber represents an active Subscribe call.
+type Subscriber interface {
+	// Topic is the topic or pattern that was subscribed to.
+	Topic() string
+	// Unsubscribe stops delivery and releases the subscription.
+	Unsubscribe() error
+}
+
+// Broker is implemented by pluggable pub/sub transports. Running a
+// cluster of mq servers on top of a shared Broker (NATS, Redis) means the
+// in-memory topics map no longer needs a custom gossip/replication layer
+// to fan messages out across replicas.
+type Broker interface {
+	Connect() error
+	Disconnect() error
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, h Handler) (Subscriber, error)
+	Unsubscribe(sub Subscriber) error
+}
+
+// Option configures a Broker constructed via New.
+type Option func(*Options)
+
+// Options holds Broker configuration populated by Option funcs.
+type Options struct {
+	Addrs []string
+}
+
+// WithAddrs sets the backend addresses a Broker connects to, e.g. a list
+// of NATS or Redis server addresses.
+func WithAddrs(addrs ...string) Option {
+	return func(o *Options) {
+		o.Addrs = addrs
+	}
+}
+
+// New constructs the named Broker backend: "http" (default), "nats" or
+// "redis".
+func New(name string, opts ...Option) (Broker, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	switch name {
+	case "", "http":
+		return newHTTPBroker(options), nil
+	case "nats":
+		return newNATSBroker(options), nil
+	case "redis":
+		return newRedisBroker(options), nil
+	default:
+		return nil, fmt.Errorf("broker: unknown backend %q", name)
+	}
+}
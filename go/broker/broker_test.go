@@ -0,0 +1,40 @@
+package broker
+
+import "testing"
+
+func TestNewDispatchesByName(t *testing.T) {
+	cases := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"", false},
+		{"http", false},
+		{"nats", false},
+		{"redis", false},
+		{"bogus", true},
+	}
+
+	for _, c := range cases {
+		b, err := New(c.name)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("New(%q): expected error, got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%q): unexpected error: %v", c.name, err)
+		}
+		if b == nil {
+			t.Errorf("New(%q): expected a non-nil Broker", c.name)
+		}
+	}
+}
+
+func TestWithAddrs(t *testing.T) {
+	var o Options
+	WithAddrs("a:1", "b:2")(&o)
+	if len(o.Addrs) != 2 || o.Addrs[0] != "a:1" || o.Addrs[1] != "b:2" {
+		t.Errorf("WithAddrs set Addrs = %v, want [a:1 b:2]", o.Addrs)
+	}
+}
@@ -0,0 +1,98 @@
+package broker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/asim/mq/go/envelope"
+	"github.com/gorilla/websocket"
+)
+
+// httpBroker is the default Broker implementation: the same HTTP POST
+// for publish and websocket fan-out the rest of mq uses, so a cluster can
+// share messages without any extra infrastructure.
+type httpBroker struct {
+	sync.RWMutex
+	addrs []string
+}
+
+func newHTTPBroker(o Options) Broker {
+	return &httpBroker{addrs: o.Addrs}
+}
+
+func (b *httpBroker) Connect() error    { return nil }
+func (b *httpBroker) Disconnect() error { return nil }
+
+func (b *httpBroker) Publish(topic string, payload []byte) error {
+	var grr error
+	for _, addr := range b.addrs {
+		url := fmt.Sprintf("%s/pub?topic=%s", addr, topic)
+		rsp, err := http.Post(url, "application/octet-stream", bytes.NewBuffer(payload))
+		if err != nil {
+			grr = err
+			continue
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			grr = fmt.Errorf("broker: non-200 response %d from %s", rsp.StatusCode, addr)
+		}
+	}
+	return grr
+}
+
+type httpSubscriber struct {
+	topic string
+	conn  *websocket.Conn
+	exit  chan bool
+}
+
+func (s *httpSubscriber) Topic() string { return s.topic }
+
+func (s *httpSubscriber) Unsubscribe() error {
+	select {
+	case <-s.exit:
+	default:
+		close(s.exit)
+		s.conn.Close()
+	}
+	return nil
+}
+
+func (b *httpBroker) Subscribe(topic string, h Handler) (Subscriber, error) {
+	if len(b.addrs) == 0 {
+		return nil, errors.New("broker: no addrs configured")
+	}
+
+	addr := strings.Replace(b.addrs[0], "http", "ws", 1)
+	url := fmt.Sprintf("%s/sub?topic=%s", addr, topic)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &httpSubscriber{topic: topic, conn: conn, exit: make(chan bool)}
+
+	go func() {
+		for {
+			_, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msgTopic, payload, err := envelope.Decode(p)
+			if err != nil {
+				continue
+			}
+			h(msgTopic, payload)
+		}
+	}()
+
+	return s, nil
+}
+
+func (b *httpBroker) Unsubscribe(sub Subscriber) error {
+	return sub.Unsubscribe()
+}
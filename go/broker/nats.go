@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsBroker maps mq topics onto NATS subjects.
+type natsBroker struct {
+	addrs []string
+	conn  *nats.Conn
+}
+
+func newNATSBroker(o Options) Broker {
+	return &natsBroker{addrs: o.Addrs}
+}
+
+func (b *natsBroker) Connect() error {
+	conn, err := nats.Connect(strings.Join(b.addrs, ","))
+	if err != nil {
+		return err
+	}
+	b.conn = conn
+	return nil
+}
+
+func (b *natsBroker) Disconnect() error {
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	return nil
+}
+
+func (b *natsBroker) Publish(topic string, payload []byte) error {
+	return b.conn.Publish(topic, payload)
+}
+
+type natsSubscriber struct {
+	topic string
+	sub   *nats.Subscription
+}
+
+func (s *natsSubscriber) Topic() string      { return s.topic }
+func (s *natsSubscriber) Unsubscribe() error { return s.sub.Unsubscribe() }
+
+func (b *natsBroker) Subscribe(topic string, h Handler) (Subscriber, error) {
+	sub, err := b.conn.Subscribe(toNATSSubject(topic), func(msg *nats.Msg) {
+		h(msg.Subject, msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &natsSubscriber{topic: topic, sub: sub}, nil
+}
+
+// toNATSSubject translates an mq topic pattern into a NATS subject. mq's
+// wildcard syntax is NATS-shaped but not identical: mq's trailing
+// multi-level wildcard is "#" where NATS uses ">", and mq accepts the
+// MQTT-style "+" as a synonym for the single-level "*" that NATS expects
+// literally. Passing an mq pattern straight through would have NATS treat
+// "#" as a literal subject token instead of a wildcard.
+func toNATSSubject(topic string) string {
+	tokens := strings.Split(topic, ".")
+	for i, t := range tokens {
+		switch t {
+		case "#":
+			tokens[i] = ">"
+		case "+":
+			tokens[i] = "*"
+		}
+	}
+	return strings.Join(tokens, ".")
+}
+
+func (b *natsBroker) Unsubscribe(sub Subscriber) error {
+	return sub.Unsubscribe()
+}
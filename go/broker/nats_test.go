@@ -0,0 +1,22 @@
+package broker
+
+import "testing"
+
+func TestToNATSSubject(t *testing.T) {
+	cases := []struct {
+		topic string
+		want  string
+	}{
+		{"foo.bar", "foo.bar"},
+		{"foo.#", "foo.>"},
+		{"foo.+.baz", "foo.*.baz"},
+		{"foo.*.baz", "foo.*.baz"},
+		{"foo.+.#", "foo.*.>"},
+	}
+
+	for _, c := range cases {
+		if got := toNATSSubject(c.topic); got != c.want {
+			t.Errorf("toNATSSubject(%q) = %q, want %q", c.topic, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisBroker maps mq topics onto Redis pub/sub channels.
+type redisBroker struct {
+	addr   string
+	ctx    context.Context
+	client *redis.Client
+}
+
+func newRedisBroker(o Options) Broker {
+	addr := "localhost:6379"
+	if len(o.Addrs) > 0 {
+		addr = o.Addrs[0]
+	}
+	return &redisBroker{addr: addr, ctx: context.Background()}
+}
+
+func (b *redisBroker) Connect() error {
+	b.client = redis.NewClient(&redis.Options{Addr: b.addr})
+	return b.client.Ping(b.ctx).Err()
+}
+
+func (b *redisBroker) Disconnect() error {
+	if b.client != nil {
+		return b.client.Close()
+	}
+	return nil
+}
+
+func (b *redisBroker) Publish(topic string, payload []byte) error {
+	return b.client.Publish(b.ctx, topic, payload).Err()
+}
+
+type redisSubscriber struct {
+	topic  string
+	pubsub *redis.PubSub
+	exit   chan bool
+}
+
+func (s *redisSubscriber) Topic() string { return s.topic }
+
+func (s *redisSubscriber) Unsubscribe() error {
+	close(s.exit)
+	return s.pubsub.Close()
+}
+
+func (b *redisBroker) Subscribe(topic string, h Handler) (Subscriber, error) {
+	var pubsub *redis.PubSub
+	if isWildcardTopic(topic) {
+		pattern, err := toRedisPattern(topic)
+		if err != nil {
+			return nil, err
+		}
+		pubsub = b.client.PSubscribe(b.ctx, pattern)
+	} else {
+		pubsub = b.client.Subscribe(b.ctx, topic)
+	}
+	if _, err := pubsub.Receive(b.ctx); err != nil {
+		return nil, err
+	}
+
+	s := &redisSubscriber{topic: topic, pubsub: pubsub, exit: make(chan bool)}
+
+	go func() {
+		ch := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				h(msg.Channel, []byte(msg.Payload))
+			case <-s.exit:
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (b *redisBroker) Unsubscribe(sub Subscriber) error {
+	return sub.Unsubscribe()
+}
+
+// isWildcardTopic reports whether topic contains an mq wildcard token and
+// therefore needs PSUBSCRIBE rather than SUBSCRIBE.
+func isWildcardTopic(topic string) bool {
+	return strings.ContainsAny(topic, "*#+")
+}
+
+// toRedisPattern translates an mq topic pattern into a Redis PSUBSCRIBE
+// glob. mq's trailing multi-level wildcard "#" matches one or more
+// trailing tokens, which a glob can express fine: the "#" token becomes
+// "*", so "foo.#" turns into "foo.*". mq's single-level wildcard "*" (and its MQTT-style
+// synonym "+") matches exactly one '.'-separated token, which a glob
+// cannot express at all — a Redis character class matches exactly one
+// character, not one token, and the "*" that would need to follow it to
+// allow a variable-length token is unbounded and swallows any further
+// "."s too, over-matching into deeper topics than mq's matchPattern (and
+// the NATS backend) would ever deliver to. Rather than silently
+// delivering messages a subscriber never asked for, toRedisPattern
+// rejects any topic containing one.
+func toRedisPattern(topic string) (string, error) {
+	tokens := strings.Split(topic, ".")
+	for i, t := range tokens {
+		switch t {
+		case "#":
+			tokens[i] = "*"
+		case "*", "+":
+			return "", fmt.Errorf("broker: redis backend can't subscribe to %q: single-level wildcards ('*', '+') have no Redis glob equivalent, only exact topics and trailing '#' patterns are supported", topic)
+		}
+	}
+	return strings.Join(tokens, "."), nil
+}
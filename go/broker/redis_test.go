@@ -0,0 +1,49 @@
+package broker
+
+import "testing"
+
+func TestToRedisPattern(t *testing.T) {
+	cases := []struct {
+		topic string
+		want  string
+	}{
+		{"foo.bar", "foo.bar"},
+		{"foo.#", "foo.*"},
+	}
+
+	for _, c := range cases {
+		got, err := toRedisPattern(c.topic)
+		if err != nil {
+			t.Fatalf("toRedisPattern(%q): unexpected error: %v", c.topic, err)
+		}
+		if got != c.want {
+			t.Errorf("toRedisPattern(%q) = %q, want %q", c.topic, got, c.want)
+		}
+	}
+}
+
+// Redis glob has no token-bounded quantifier, so a single-level wildcard
+// ("*" or "+") can't be translated without over-matching into deeper
+// topics; toRedisPattern rejects it rather than silently over-subscribing.
+func TestToRedisPatternRejectsSingleLevelWildcard(t *testing.T) {
+	for _, topic := range []string{"foo.*", "foo.+.baz", "foo.*.baz", "foo.+.#"} {
+		if _, err := toRedisPattern(topic); err == nil {
+			t.Errorf("toRedisPattern(%q): expected error for an unsupported single-level wildcard", topic)
+		}
+	}
+}
+
+func TestIsWildcardTopic(t *testing.T) {
+	cases := map[string]bool{
+		"foo.bar": false,
+		"foo.#":   true,
+		"foo.*":   true,
+		"foo.+":   true,
+	}
+
+	for topic, want := range cases {
+		if got := isWildcardTopic(topic); got != want {
+			t.Errorf("isWildcardTopic(%q) = %v, want %v", topic, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/asim/mq/go/envelope"
+	"github.com/gorilla/websocket"
+)
+
+// ackFrameType distinguishes the two kinds of control frame a client can
+// send back to the server over an ack-mode subscription.
+type ackFrameType byte
+
+const (
+	ackFrame  ackFrameType = 'A'
+	nackFrame ackFrameType = 'N'
+)
+
+// decodeAckEnvelope parses an ack-mode delivery: an 8-byte big-endian
+// sequence number followed by the usual topic-framed envelope.
+func decodeAckEnvelope(b []byte) (seq uint64, topic string, payload []byte, err error) {
+	if len(b) < 8 {
+		return 0, "", nil, errors.New("mq: ack envelope too short")
+	}
+	seq = binary.BigEndian.Uint64(b[0:8])
+	topic, payload, err = envelope.Decode(b[8:])
+	return seq, topic, payload, err
+}
+
+// encodeAckControl frames an ack or nack control message: a single type
+// byte followed by the 8-byte sequence number it refers to.
+func encodeAckControl(t ackFrameType, seq uint64) []byte {
+	buf := make([]byte, 9)
+	buf[0] = byte(t)
+	binary.BigEndian.PutUint64(buf[1:9], seq)
+	return buf
+}
+
+// AckMsg is delivered to a subscriber of SubscribeAck. The handler should
+// call Ack once it has durably processed the message, or Nack to ask the
+// server to redeliver it immediately; anything left unacknowledged is
+// redelivered automatically once the server's ack timeout elapses.
+type AckMsg struct {
+	Topic   string
+	Payload []byte
+	Seq     uint64
+
+	conn    *websocket.Conn
+	writeMu *sync.Mutex
+}
+
+// Ack acknowledges m, telling the server it doesn't need to redeliver it.
+func (m *AckMsg) Ack() error {
+	return m.send(ackFrame)
+}
+
+// Nack asks the server to redeliver m immediately rather than waiting out
+// its ack timeout.
+func (m *AckMsg) Nack() error {
+	return m.send(nackFrame)
+}
+
+func (m *AckMsg) send(t ackFrameType) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	return m.conn.WriteMessage(websocket.BinaryMessage, encodeAckControl(t, m.Seq))
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDecodeAckEnvelope(t *testing.T) {
+	topic := "foo.bar"
+	payload := []byte("hello")
+
+	env := make([]byte, 2+len(topic)+len(payload))
+	binary.BigEndian.PutUint16(env[0:2], uint16(len(topic)))
+	copy(env[2:], topic)
+	copy(env[2+len(topic):], payload)
+
+	buf := make([]byte, 8+len(env))
+	binary.BigEndian.PutUint64(buf[0:8], 42)
+	copy(buf[8:], env)
+
+	seq, gotTopic, gotPayload, err := decodeAckEnvelope(buf)
+	if err != nil {
+		t.Fatalf("decodeAckEnvelope: %v", err)
+	}
+	if seq != 42 {
+		t.Errorf("seq = %d, want 42", seq)
+	}
+	if gotTopic != topic {
+		t.Errorf("topic = %q, want %q", gotTopic, topic)
+	}
+	if string(gotPayload) != string(payload) {
+		t.Errorf("payload = %q, want %q", gotPayload, payload)
+	}
+}
+
+func TestDecodeAckEnvelopeTooShort(t *testing.T) {
+	if _, _, _, err := decodeAckEnvelope([]byte{1, 2, 3}); err == nil {
+		t.Error("expected error for too-short ack envelope")
+	}
+}
+
+func TestEncodeAckControl(t *testing.T) {
+	b := encodeAckControl(ackFrame, 9)
+	if len(b) != 9 {
+		t.Fatalf("len = %d, want 9", len(b))
+	}
+	if ackFrameType(b[0]) != ackFrame {
+		t.Errorf("type byte = %v, want %v", b[0], ackFrame)
+	}
+	if got := binary.BigEndian.Uint64(b[1:9]); got != 9 {
+		t.Errorf("seq = %d, want 9", got)
+	}
+}
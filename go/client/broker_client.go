@@ -0,0 +1,149 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/asim/mq/go/broker"
+)
+
+// brokerClient is a Client backed directly by a broker.Broker (NATS,
+// Redis, ...) instead of plain HTTP/WS to an mq server. It's the client
+// counterpart of the mq server's own -broker flag: a caller that wants to
+// join a broker-backed cluster as a peer, rather than talk HTTP to one of
+// its servers, uses WithBroker instead of WithServers.
+type brokerClient struct {
+	b       broker.Broker
+	options Options
+	errs    chan error
+
+	sync.RWMutex
+	subscribers     map[<-chan []byte]broker.Subscriber
+	metaSubscribers map[<-chan Message]broker.Subscriber
+}
+
+func (c *brokerClient) emitError(err error) {
+	select {
+	case c.errs <- err:
+	default:
+	}
+}
+
+func (c *brokerClient) Errors() <-chan error {
+	return c.errs
+}
+
+func (c *brokerClient) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	for _, sub := range c.subscribers {
+		sub.Unsubscribe()
+	}
+	for _, sub := range c.metaSubscribers {
+		sub.Unsubscribe()
+	}
+	return c.b.Disconnect()
+}
+
+func (c *brokerClient) Publish(topic string, payload []byte) error {
+	return c.b.Publish(topic, payload)
+}
+
+func (c *brokerClient) Subscribe(topic string) (<-chan []byte, error) {
+	ch := make(chan []byte, 256)
+
+	sub, err := c.b.Subscribe(topic, func(_ string, payload []byte) {
+		select {
+		case ch <- payload:
+		default:
+			c.emitError(fmt.Errorf("mq: dropped message on topic %q: subscriber not keeping up", topic))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	c.subscribers[ch] = sub
+	c.Unlock()
+
+	return ch, nil
+}
+
+// SubscribeWithMeta subscribes like Subscribe but also exposes the
+// concrete topic each payload arrived on, which matters when topic is a
+// wildcard pattern.
+func (c *brokerClient) SubscribeWithMeta(topic string) (<-chan Message, error) {
+	ch := make(chan Message, 256)
+
+	sub, err := c.b.Subscribe(topic, func(msgTopic string, payload []byte) {
+		select {
+		case ch <- Message{Topic: msgTopic, Payload: payload}:
+		default:
+			c.emitError(fmt.Errorf("mq: dropped message on topic %q: subscriber not keeping up", topic))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	c.metaSubscribers[ch] = sub
+	c.Unlock()
+
+	return ch, nil
+}
+
+func (c *brokerClient) Unsubscribe(ch <-chan []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if sub, ok := c.subscribers[ch]; ok {
+		delete(c.subscribers, ch)
+		return c.b.Unsubscribe(sub)
+	}
+	return nil
+}
+
+// SubscribeAck isn't supported on a broker-backed Client: at-least-once
+// redelivery is tracked by the mq server against a single caller
+// connection, and a broker.Broker has no notion of one, only topics.
+func (c *brokerClient) SubscribeAck(topic string, resume uint64) (<-chan *AckMsg, error) {
+	return nil, errors.New("mq: SubscribeAck isn't supported by a broker-backed Client")
+}
+
+// UnsubscribeAck isn't supported on a broker-backed Client; see
+// SubscribeAck.
+func (c *brokerClient) UnsubscribeAck(ch <-chan *AckMsg) error {
+	return errors.New("mq: UnsubscribeAck isn't supported by a broker-backed Client")
+}
+
+// NewBrokerClient returns a Client that publishes and subscribes directly
+// through the broker backend named by options.BrokerName, set via
+// WithBroker.
+func NewBrokerClient(opts ...Option) (*brokerClient, error) {
+	options := Options{
+		Selector: new(SelectAll),
+		Servers:  Servers,
+		Retries:  Retries,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	b, err := broker.New(options.BrokerName, broker.WithAddrs(options.BrokerAddrs...))
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Connect(); err != nil {
+		return nil, err
+	}
+
+	return &brokerClient{
+		b:               b,
+		options:         options,
+		errs:            make(chan error, 16),
+		subscribers:     make(map[<-chan []byte]broker.Subscriber),
+		metaSubscribers: make(map[<-chan Message]broker.Subscriber),
+	}, nil
+}
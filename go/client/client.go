@@ -0,0 +1,59 @@
+// Package client provides an MQ client.
+package client
+
+// Message is delivered to a subscriber that wants to know which concrete
+// topic a payload arrived on, e.g. a pattern subscriber.
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Client is the interface implemented by MQ client backends.
+type Client interface {
+	// Publish publishes payload to topic.
+	Publish(topic string, payload []byte) error
+	// Subscribe subscribes to topic or a wildcard pattern, returning a
+	// channel of payloads.
+	Subscribe(topic string) (<-chan []byte, error)
+	// SubscribeWithMeta subscribes like Subscribe but also exposes the
+	// concrete topic each payload arrived on.
+	SubscribeWithMeta(topic string) (<-chan Message, error)
+	// Unsubscribe stops delivery to a channel returned by Subscribe. The
+	// channel itself is not closed.
+	Unsubscribe(ch <-chan []byte) error
+	// SubscribeAck subscribes to topic in at-least-once mode: every
+	// delivery carries a sequence number and is redelivered by the server
+	// until AckMsg.Ack is called. Pass resume to continue a previous
+	// ack-mode subscription to the same topic from the given sequence
+	// number, or 0 to start fresh.
+	SubscribeAck(topic string, resume uint64) (<-chan *AckMsg, error)
+	// UnsubscribeAck stops delivery to a channel returned by SubscribeAck.
+	// The channel itself is not closed.
+	UnsubscribeAck(ch <-chan *AckMsg) error
+	// Request publishes payload to topic and blocks for a reply, up to
+	// the Client's configured request timeout.
+	Request(topic string, payload []byte) ([]byte, error)
+	// Handle subscribes to topic and invokes fn for every request
+	// received, wiring up Msg.Reply to route back to the requester.
+	Handle(topic string, fn func(*Msg)) error
+	// Errors returns a channel of errors from background subscription
+	// goroutines, e.g. a message dropped because the caller wasn't
+	// reading fast enough.
+	Errors() <-chan error
+	// Close closes the client and all of its subscriptions.
+	Close() error
+}
+
+// New returns the default Client implementation: a plain HTTP/WS client
+// talking to an mq server, or, when WithBroker is given, a Client backed
+// directly by that broker.Broker cluster.
+func New(opts ...Option) (Client, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.BrokerName) > 0 {
+		return NewBrokerClient(opts...)
+	}
+	return NewHTTPClient(opts...), nil
+}
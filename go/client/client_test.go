@@ -0,0 +1,20 @@
+package client
+
+import "testing"
+
+func TestWithBroker(t *testing.T) {
+	var o Options
+	WithBroker("nats", "a:1", "b:2")(&o)
+	if o.BrokerName != "nats" {
+		t.Errorf("BrokerName = %q, want %q", o.BrokerName, "nats")
+	}
+	if len(o.BrokerAddrs) != 2 || o.BrokerAddrs[0] != "a:1" || o.BrokerAddrs[1] != "b:2" {
+		t.Errorf("BrokerAddrs = %v, want [a:1 b:2]", o.BrokerAddrs)
+	}
+}
+
+func TestNewRejectsUnknownBroker(t *testing.T) {
+	if _, err := New(WithBroker("bogus")); err == nil {
+		t.Error("expected an error for an unknown broker backend")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/asim/mq/go/envelope"
 	"github.com/gorilla/websocket"
 )
 
@@ -16,22 +17,66 @@ import (
 type httpClient struct {
 	exit    chan bool
 	options Options
+	errs    chan error
 
 	sync.RWMutex
-	subscribers map[<-chan []byte]*subscriber
+	subscribers     map[<-chan []byte]*subscriber
+	metaSubscribers map[<-chan Message]*subscriber
+	ackSubscribers  map[<-chan *AckMsg]*ackSubscriber
+}
+
+// emitError delivers err on Errors(), dropping it if nothing is
+// currently listening rather than blocking the caller.
+func (c *httpClient) emitError(err error) {
+	select {
+	case c.errs <- err:
+	default:
+	}
+}
+
+// Errors returns a channel of errors encountered by background
+// subscription goroutines, e.g. a message dropped because the caller
+// wasn't reading from a subscribed channel fast enough.
+func (c *httpClient) Errors() <-chan error {
+	return c.errs
 }
 
 // internal subscriber
 type subscriber struct {
-	wg    sync.WaitGroup
-	ch    chan<- []byte
-	exit  chan bool
-	topic string
+	wg sync.WaitGroup
+	// deliver is called with each decoded (topic, payload) pair; it
+	// returns false when the subscriber should stop reading, e.g. because
+	// exit has been closed.
+	deliver func(topic string, payload []byte) bool
+	exit    chan bool
+	topic   string
+}
+
+// internal ackSubscriber, the SubscribeAck counterpart of subscriber.
+type ackSubscriber struct {
+	wg sync.WaitGroup
+	// deliver is called with each decoded *AckMsg; it returns false when
+	// the subscriber should stop reading, e.g. because exit has been
+	// closed.
+	deliver    func(msg *AckMsg) bool
+	exit       chan bool
+	topic      string
+	resume     uint64
+	ackTimeout time.Duration
 }
 
-func publish(addr, topic string, payload []byte) error {
+func publish(addr, topic string, payload []byte, token string) error {
 	url := fmt.Sprintf("%s/pub?topic=%s", addr, topic)
-	rsp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -42,13 +87,16 @@ func publish(addr, topic string, payload []byte) error {
 	return nil
 }
 
-func subscribe(addr string, s *subscriber) error {
+func subscribe(addr string, s *subscriber, token string) error {
 	if strings.HasPrefix(addr, "http") {
 		addr = strings.TrimPrefix(addr, "http")
 		addr = "ws" + addr
 	}
 
 	url := fmt.Sprintf("%s/sub?topic=%s", addr, s.topic)
+	if len(token) > 0 {
+		url = fmt.Sprintf("%s&token=%s", url, token)
+	}
 	c, _, err := websocket.DefaultDialer.Dial(url, make(http.Header))
 	if err != nil {
 		return err
@@ -71,9 +119,71 @@ func subscribe(addr string, s *subscriber) error {
 				return
 			}
 
-			select {
-			case s.ch <- p:
-			case <-s.exit:
+			topic, payload, err := envelope.Decode(p)
+			if err != nil {
+				c.Close()
+				return
+			}
+
+			if !s.deliver(topic, payload) {
+				c.Close()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func subscribeAck(addr string, s *ackSubscriber, token string) error {
+	if strings.HasPrefix(addr, "http") {
+		addr = strings.TrimPrefix(addr, "http")
+		addr = "ws" + addr
+	}
+
+	url := fmt.Sprintf("%s/sub?topic=%s&ack=1", addr, s.topic)
+	if s.resume > 0 {
+		url = fmt.Sprintf("%s&resume=%d", url, s.resume)
+	}
+	if s.ackTimeout > 0 {
+		url = fmt.Sprintf("%s&ack_timeout=%s", url, s.ackTimeout)
+	}
+	if len(token) > 0 {
+		url = fmt.Sprintf("%s&token=%s", url, token)
+	}
+
+	c, _, err := websocket.DefaultDialer.Dial(url, make(http.Header))
+	if err != nil {
+		return err
+	}
+
+	writeMu := &sync.Mutex{}
+
+	go func() {
+		select {
+		case <-s.exit:
+			c.Close()
+		}
+	}()
+
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			t, p, err := c.ReadMessage()
+			if err != nil || t == websocket.CloseMessage {
+				c.Close()
+				return
+			}
+
+			seq, topic, payload, err := decodeAckEnvelope(p)
+			if err != nil {
+				c.Close()
+				return
+			}
+
+			msg := &AckMsg{Topic: topic, Payload: payload, Seq: seq, conn: c, writeMu: writeMu}
+			if !s.deliver(msg) {
 				c.Close()
 				return
 			}
@@ -131,6 +241,12 @@ func (c *httpClient) Close() error {
 		for _, sub := range c.subscribers {
 			sub.Close()
 		}
+		for _, sub := range c.metaSubscribers {
+			sub.Close()
+		}
+		for _, sub := range c.ackSubscribers {
+			sub.Close()
+		}
 		c.Unlock()
 	}
 	return nil
@@ -151,7 +267,7 @@ func (c *httpClient) Publish(topic string, payload []byte) error {
 	var grr error
 	for _, addr := range servers {
 		for i := 0; i < 1+c.options.Retries; i++ {
-			err := publish(addr, topic, payload)
+			err := publish(addr, topic, payload, c.options.Token)
 			if err == nil {
 				break
 			}
@@ -176,15 +292,83 @@ func (c *httpClient) Subscribe(topic string) (<-chan []byte, error) {
 	ch := make(chan []byte, len(c.options.Servers)*256)
 
 	s := &subscriber{
-		ch:    ch,
 		exit:  make(chan bool),
 		topic: topic,
 	}
+	s.deliver = func(topic string, payload []byte) bool {
+		select {
+		case <-s.exit:
+			return false
+		default:
+		}
+
+		select {
+		case ch <- payload:
+		default:
+			c.emitError(fmt.Errorf("mq: dropped message on topic %q: subscriber not keeping up", topic))
+		}
+		return true
+	}
+
+	var grr error
+	for _, addr := range servers {
+		for i := 0; i < 1+c.options.Retries; i++ {
+			err := subscribe(addr, s, c.options.Token)
+			if err == nil {
+				s.wg.Add(1)
+				break
+			}
+			grr = err
+		}
+	}
+
+	c.Lock()
+	c.subscribers[ch] = s
+	c.Unlock()
+
+	return ch, grr
+}
+
+// SubscribeWithMeta subscribes like Subscribe but also exposes the
+// concrete topic each payload was published to, which matters when topic
+// is a wildcard pattern.
+func (c *httpClient) SubscribeWithMeta(topic string) (<-chan Message, error) {
+	select {
+	case <-c.exit:
+		return nil, errors.New("client closed")
+	default:
+	}
+
+	servers, err := c.options.Selector.Get(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Message, len(c.options.Servers)*256)
+
+	s := &subscriber{
+		exit:  make(chan bool),
+		topic: topic,
+	}
+	s.deliver = func(topic string, payload []byte) bool {
+		select {
+		case <-s.exit:
+			return false
+		default:
+		}
+
+		select {
+		case ch <- Message{Topic: topic, Payload: payload}:
+		default:
+			c.emitError(fmt.Errorf("mq: dropped message on topic %q: subscriber not keeping up", topic))
+		}
+		return true
+	}
 
 	var grr error
 	for _, addr := range servers {
 		for i := 0; i < 1+c.options.Retries; i++ {
-			err := subscribe(addr, s)
+			err := subscribe(addr, s, c.options.Token)
 			if err == nil {
 				s.wg.Add(1)
 				break
@@ -193,6 +377,10 @@ func (c *httpClient) Subscribe(topic string) (<-chan []byte, error) {
 		}
 	}
 
+	c.Lock()
+	c.metaSubscribers[ch] = s
+	c.Unlock()
+
 	return ch, grr
 }
 
@@ -221,6 +409,92 @@ func (s *subscriber) Close() error {
 	return nil
 }
 
+// SubscribeAck subscribes to topic in at-least-once mode: every delivery
+// carries a sequence number and is redelivered by the server until
+// AckMsg.Ack is called. Pass resume to continue a previous ack-mode
+// subscription to the same topic from the given sequence number, or 0 to
+// start fresh.
+func (c *httpClient) SubscribeAck(topic string, resume uint64) (<-chan *AckMsg, error) {
+	select {
+	case <-c.exit:
+		return nil, errors.New("client closed")
+	default:
+	}
+
+	servers, err := c.options.Selector.Get(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *AckMsg, len(c.options.Servers)*256)
+
+	s := &ackSubscriber{
+		exit:       make(chan bool),
+		topic:      topic,
+		resume:     resume,
+		ackTimeout: c.options.AckTimeout,
+	}
+	s.deliver = func(msg *AckMsg) bool {
+		select {
+		case <-s.exit:
+			return false
+		default:
+		}
+
+		select {
+		case ch <- msg:
+		default:
+			c.emitError(fmt.Errorf("mq: dropped ack message on topic %q: subscriber not keeping up", topic))
+		}
+		return true
+	}
+
+	var grr error
+	for _, addr := range servers {
+		for i := 0; i < 1+c.options.Retries; i++ {
+			err := subscribeAck(addr, s, c.options.Token)
+			if err == nil {
+				s.wg.Add(1)
+				break
+			}
+			grr = err
+		}
+	}
+
+	c.Lock()
+	c.ackSubscribers[ch] = s
+	c.Unlock()
+
+	return ch, grr
+}
+
+// UnsubscribeAck stops delivery to a channel returned by SubscribeAck.
+// The channel itself is not closed.
+func (c *httpClient) UnsubscribeAck(ch <-chan *AckMsg) error {
+	select {
+	case <-c.exit:
+		return errors.New("client closed")
+	default:
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if sub, ok := c.ackSubscribers[ch]; ok {
+		return sub.Close()
+	}
+	return nil
+}
+
+func (s *ackSubscriber) Close() error {
+	select {
+	case <-s.exit:
+	default:
+		close(s.exit)
+		s.wg.Wait()
+	}
+	return nil
+}
+
 // NewHTTPClient returns a http Client
 func NewHTTPClient(opts ...Option) *httpClient {
 	options := Options{
@@ -247,10 +521,13 @@ func NewHTTPClient(opts ...Option) *httpClient {
 	options.Selector.Set(options.Servers...)
 
 	c := &httpClient{
-		exit:        make(chan bool),
-		options:     options,
-		subscribers: make(map[<-chan []byte]*subscriber),
+		exit:            make(chan bool),
+		options:         options,
+		errs:            make(chan error, 16),
+		subscribers:     make(map[<-chan []byte]*subscriber),
+		metaSubscribers: make(map[<-chan Message]*subscriber),
+		ackSubscribers:  make(map[<-chan *AckMsg]*ackSubscriber),
 	}
 	go c.run()
 	return c
-}
\ No newline at end of file
+}
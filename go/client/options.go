@@ -0,0 +1,90 @@
+package client
+
+import "time"
+
+// Servers is the default MQ server list used when none is provided.
+var Servers = []string{"http://localhost:8081"}
+
+// Retries is the default number of publish/subscribe retries per server.
+var Retries = 1
+
+// Option configures a Client.
+type Option func(*Options)
+
+// Options holds Client configuration populated by Option funcs.
+type Options struct {
+	Servers        []string
+	Retries        int
+	Selector       Selector
+	Resolver       Resolver
+	RequestTimeout time.Duration
+	Token          string
+	AckTimeout     time.Duration
+	BrokerName     string
+	BrokerAddrs    []string
+}
+
+// WithServers sets the MQ server list used by the Client.
+func WithServers(servers ...string) Option {
+	return func(o *Options) {
+		o.Servers = servers
+	}
+}
+
+// WithRetries sets the number of retries attempted per server.
+func WithRetries(retries int) Option {
+	return func(o *Options) {
+		o.Retries = retries
+	}
+}
+
+// WithSelector sets the Selector used to pick servers for a topic.
+func WithSelector(s Selector) Option {
+	return func(o *Options) {
+		o.Selector = s
+	}
+}
+
+// WithResolver sets the Resolver used to refresh the server list from
+// logical server names.
+func WithResolver(r Resolver) Option {
+	return func(o *Options) {
+		o.Resolver = r
+	}
+}
+
+// WithRequestTimeout sets how long Request waits for a reply before
+// giving up.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.RequestTimeout = d
+	}
+}
+
+// WithToken sets the bearer token sent with every publish and subscribe
+// request, for servers started with -auth.
+func WithToken(token string) Option {
+	return func(o *Options) {
+		o.Token = token
+	}
+}
+
+// WithAckTimeout sets how long the server waits for a SubscribeAck
+// delivery to be acknowledged before redelivering it.
+func WithAckTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.AckTimeout = d
+	}
+}
+
+// WithBroker configures the Client to publish and subscribe directly
+// through the named broker.Broker backend ("nats" or "redis") instead of
+// plain HTTP/WS to an mq server, mirroring the server's own -broker flag
+// for joining a broker-backed cluster as a peer. addrs are the broker
+// backend's addresses.
+func WithBroker(name string, addrs ...string) Option {
+	return func(o *Options) {
+		o.BrokerName = name
+		o.BrokerAddrs = addrs
+	}
+}
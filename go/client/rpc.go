@@ -0,0 +1,210 @@
+package client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// msgType distinguishes the three kinds of message that can flow over the
+// bus: a plain fire-and-forget event, an RPC request, and its reply.
+type msgType int
+
+const (
+	typeEvent msgType = iota
+	typeRequest
+	typeReply
+)
+
+// rpcHeader is prepended to the payload of any message sent through
+// Request/Reply so the receiving side can correlate requests with
+// replies.
+type rpcHeader struct {
+	ID      string  `json:"id"`
+	ReplyTo string  `json:"reply_to,omitempty"`
+	Type    msgType `json:"type"`
+}
+
+// DefaultRequestTimeout is used by Request when the Client wasn't
+// configured with WithRequestTimeout.
+var DefaultRequestTimeout = 5 * time.Second
+
+var requestSeq uint64
+
+func newRequestID() string {
+	return fmt.Sprintf("%d.%d", time.Now().UnixNano(), atomic.AddUint64(&requestSeq, 1))
+}
+
+// encodeRPC frames a header and payload as a 4-byte big-endian header
+// length, the JSON-encoded header, then the raw payload.
+func encodeRPC(h rpcHeader, payload []byte) ([]byte, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4+len(b)+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(b)))
+	copy(buf[4:], b)
+	copy(buf[4+len(b):], payload)
+	return buf, nil
+}
+
+// decodeRPC reverses encodeRPC.
+func decodeRPC(b []byte) (rpcHeader, []byte, error) {
+	var h rpcHeader
+	if len(b) < 4 {
+		return h, nil, errors.New("mq: rpc frame too short")
+	}
+	n := binary.BigEndian.Uint32(b[0:4])
+	if len(b) < 4+int(n) {
+		return h, nil, errors.New("mq: rpc frame truncated")
+	}
+	if err := json.Unmarshal(b[4:4+n], &h); err != nil {
+		return h, nil, err
+	}
+	return h, b[4+n:], nil
+}
+
+// Msg is delivered to an RPC handler registered with Handle. It carries
+// the decoded request payload and knows how to reply to the requester.
+type Msg struct {
+	Topic   string
+	Payload []byte
+
+	header rpcHeader
+	client Client
+}
+
+// Reply publishes payload back to the requester that sent m. It errors if
+// m carries no reply-to topic, i.e. it wasn't sent by Request.
+func (m *Msg) Reply(payload []byte) error {
+	if len(m.header.ReplyTo) == 0 {
+		return errors.New("mq: message has no reply-to topic")
+	}
+
+	frame, err := encodeRPC(rpcHeader{ID: m.header.ID, Type: typeReply}, payload)
+	if err != nil {
+		return err
+	}
+	return m.client.Publish(m.header.ReplyTo, frame)
+}
+
+// Request publishes payload to topic and blocks until a reply tagged with
+// the matching request ID arrives or the Client's request timeout
+// elapses. The reply topic is an ephemeral "_inbox." topic the server
+// delivers directly to this subscriber rather than broadcasting.
+func (c *httpClient) Request(topic string, payload []byte) ([]byte, error) {
+	timeout := c.options.RequestTimeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	id := newRequestID()
+	replyTo := "_inbox." + id
+
+	ch, err := c.Subscribe(replyTo)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Unsubscribe(ch)
+
+	frame, err := encodeRPC(rpcHeader{ID: id, ReplyTo: replyTo, Type: typeRequest}, payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Publish(topic, frame); err != nil {
+		return nil, err
+	}
+
+	select {
+	case b := <-ch:
+		_, reply, err := decodeRPC(b)
+		return reply, err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("mq: request to %q timed out after %s", topic, timeout)
+	}
+}
+
+// Handle subscribes to topic and invokes fn for each message received,
+// decoding its RPC header so fn's Msg.Reply routes back to the original
+// requester.
+func (c *httpClient) Handle(topic string, fn func(*Msg)) error {
+	ch, err := c.Subscribe(topic)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for b := range ch {
+			header, payload, err := decodeRPC(b)
+			if err != nil {
+				continue
+			}
+			fn(&Msg{Topic: topic, Payload: payload, header: header, client: c})
+		}
+	}()
+
+	return nil
+}
+
+// Request publishes payload to topic and blocks until a reply tagged with
+// the matching request ID arrives or the Client's request timeout
+// elapses. The reply topic is a unique ephemeral "_inbox." topic, so only
+// this subscriber listens on it; the broker gives it no special routing.
+func (c *brokerClient) Request(topic string, payload []byte) ([]byte, error) {
+	timeout := c.options.RequestTimeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	id := newRequestID()
+	replyTo := "_inbox." + id
+
+	ch, err := c.Subscribe(replyTo)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Unsubscribe(ch)
+
+	frame, err := encodeRPC(rpcHeader{ID: id, ReplyTo: replyTo, Type: typeRequest}, payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Publish(topic, frame); err != nil {
+		return nil, err
+	}
+
+	select {
+	case b := <-ch:
+		_, reply, err := decodeRPC(b)
+		return reply, err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("mq: request to %q timed out after %s", topic, timeout)
+	}
+}
+
+// Handle subscribes to topic and invokes fn for each message received,
+// decoding its RPC header so fn's Msg.Reply routes back to the original
+// requester.
+func (c *brokerClient) Handle(topic string, fn func(*Msg)) error {
+	ch, err := c.Subscribe(topic)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for b := range ch {
+			header, payload, err := decodeRPC(b)
+			if err != nil {
+				continue
+			}
+			fn(&Msg{Topic: topic, Payload: payload, header: header, client: c})
+		}
+	}()
+
+	return nil
+}
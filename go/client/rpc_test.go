@@ -0,0 +1,44 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDecodeRPCRoundTrip(t *testing.T) {
+	h := rpcHeader{ID: "1.1", ReplyTo: "_inbox.1.1", Type: typeRequest}
+	payload := []byte(`{"hello":"world"}`)
+
+	b, err := encodeRPC(h, payload)
+	if err != nil {
+		t.Fatalf("encodeRPC: %v", err)
+	}
+
+	gotHeader, gotPayload, err := decodeRPC(b)
+	if err != nil {
+		t.Fatalf("decodeRPC: %v", err)
+	}
+	if gotHeader != h {
+		t.Errorf("header = %+v, want %+v", gotHeader, h)
+	}
+	if !bytes.Equal(gotPayload, payload) {
+		t.Errorf("payload = %q, want %q", gotPayload, payload)
+	}
+}
+
+func TestDecodeRPCErrors(t *testing.T) {
+	if _, _, err := decodeRPC([]byte{0, 0}); err == nil {
+		t.Error("expected error for too-short frame")
+	}
+	if _, _, err := decodeRPC([]byte{0, 0, 0, 5, 'a'}); err == nil {
+		t.Error("expected error for truncated frame")
+	}
+}
+
+func TestNewRequestIDUnique(t *testing.T) {
+	a := newRequestID()
+	b := newRequestID()
+	if a == b {
+		t.Errorf("newRequestID produced duplicate IDs: %q", a)
+	}
+}
@@ -0,0 +1,37 @@
+package client
+
+import "sync"
+
+// Selector picks which servers a topic's publish/subscribe calls should
+// use.
+type Selector interface {
+	Set(servers ...string)
+	Get(topic string) ([]string, error)
+}
+
+// Resolver resolves a logical server name to one or more addresses. It's
+// used to periodically refresh a Client's server list.
+type Resolver interface {
+	Resolve(name string) ([]string, error)
+}
+
+// SelectAll is a Selector that always returns every known server,
+// regardless of topic.
+type SelectAll struct {
+	sync.RWMutex
+	servers []string
+}
+
+// Set replaces the known server list.
+func (s *SelectAll) Set(servers ...string) {
+	s.Lock()
+	s.servers = servers
+	s.Unlock()
+}
+
+// Get returns every known server.
+func (s *SelectAll) Get(topic string) ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.servers, nil
+}
@@ -0,0 +1,34 @@
+// Package envelope implements the wire framing mq uses to tag a payload
+// with the topic it was published to: a 2-byte big-endian topic length,
+// the topic bytes, then the payload. Pattern subscribers need this to
+// tell which concrete topic a delivery arrived on. The mq server, its
+// HTTP client, and its HTTP broker backend all speak this same frame.
+package envelope
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Encode frames payload with the topic it was published to.
+func Encode(topic string, payload []byte) []byte {
+	buf := make([]byte, 2+len(topic)+len(payload))
+	binary.BigEndian.PutUint16(buf[0:2], uint16(len(topic)))
+	copy(buf[2:], topic)
+	copy(buf[2+len(topic):], payload)
+	return buf
+}
+
+// Decode reverses Encode.
+func Decode(b []byte) (topic string, payload []byte, err error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("envelope: too short")
+	}
+	n := binary.BigEndian.Uint16(b[0:2])
+	if len(b) < 2+int(n) {
+		return "", nil, errors.New("envelope: truncated")
+	}
+	topic = string(b[2 : 2+n])
+	payload = b[2+n:]
+	return topic, payload, nil
+}
@@ -0,0 +1,33 @@
+package envelope
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	topic := "foo.bar"
+	payload := []byte("hello world")
+
+	b := Encode(topic, payload)
+
+	gotTopic, gotPayload, err := Decode(b)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if gotTopic != topic {
+		t.Errorf("topic = %q, want %q", gotTopic, topic)
+	}
+	if !bytes.Equal(gotPayload, payload) {
+		t.Errorf("payload = %q, want %q", gotPayload, payload)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, _, err := Decode([]byte{0}); err == nil {
+		t.Error("expected error for too-short envelope")
+	}
+	if _, _, err := Decode([]byte{0, 5, 'a'}); err == nil {
+		t.Error("expected error for truncated envelope")
+	}
+}
@@ -1,47 +1,172 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/asim/mq/go/broker"
 	"github.com/asim/mq/go/client"
+	"github.com/asim/mq/go/envelope"
 	"github.com/gorilla/websocket"
 )
 
+// delivery is what's pushed to a subscriber channel. It carries the
+// concrete topic a message was published to so pattern subscribers can
+// tell which topic matched, and, when the message was appended to
+// per-topic storage, the storage ID it was assigned so an ack-mode
+// subscription on that exact topic can use it as its sequence number.
+type delivery struct {
+	topic     string
+	payload   []byte
+	storageID uint64
+	hasID     bool
+}
+
 type mq struct {
-	client client.Client
+	client  client.Client
+	cluster broker.Broker
+	store   Storage
 
 	sync.RWMutex
-	topics map[string][]chan []byte
+	topics      map[string][]*subscription
+	patterns    map[string][]*subscription
+	clusterSubs map[<-chan *delivery]broker.Subscriber
+	stats       map[string]*dropCounters
 }
 
 var (
-	address = flag.String("address", ":8081", "MQ server address")
-	cert    = flag.String("cert_file", "", "TLS certificate file")
-	key     = flag.String("key_file", "", "TLS key file")
-	proxy   = flag.Bool("proxy", false, "Proxy for an MQ cluster")
-	servers = flag.String("servers", "", "Comma separated MQ cluster list used by Proxy")
+	address       = flag.String("address", ":8081", "MQ server address")
+	cert          = flag.String("cert_file", "", "TLS certificate file")
+	key           = flag.String("key_file", "", "TLS key file")
+	proxy         = flag.Bool("proxy", false, "Proxy for an MQ cluster")
+	servers       = flag.String("servers", "", "Comma separated MQ cluster list used by Proxy")
+	brokerFlag    = flag.String("broker", "", "Cluster broker used when -proxy is set: nats, redis (default: HTTP proxy via -servers)")
+	brokerAddrs   = flag.String("broker_addrs", "", "Comma separated broker addresses, used with -broker")
+	storageFlag   = flag.String("storage", "", "Persistent topic storage backend: memory, file (default: none)")
+	storageDir    = flag.String("storage_dir", "./data", "Directory used by the file storage backend")
+	sweepInterval = flag.Duration("sweep_interval", 10*time.Second, "Interval between storage sweeps")
+	authFlag      = flag.String("auth", "", "Path to a JSON/YAML token->ACL config enabling authentication")
 
 	defaultMQ *mq
+	auth      Authorizer
 )
 
-func init() {
-	flag.Parse()
+// setup validates the parsed flags and builds defaultMQ. It must run after
+// flag.Parse(), so main calls it directly rather than leaving it to init,
+// which always runs before main gets a chance to parse anything — and
+// which go test also runs, against the test binary's own argv.
+func setup() {
+	if *proxy && len(*servers) == 0 && len(*brokerFlag) == 0 {
+		log.Fatal("Proxy enabled without MQ server list or broker")
+	}
+
+	var cluster broker.Broker
+	if *proxy && len(*brokerFlag) > 0 {
+		b, err := broker.New(*brokerFlag, broker.WithAddrs(strings.Split(*brokerAddrs, ",")...))
+		if err != nil {
+			log.Fatalf("Failed to create %s broker: %v", *brokerFlag, err)
+		}
+		if err := b.Connect(); err != nil {
+			log.Fatalf("Failed to connect to %s broker: %v", *brokerFlag, err)
+		}
+		cluster = b
+	}
 
-	if *proxy && len(*servers) == 0 {
-		log.Fatal("Proxy enabled without MQ server list")
+	var store Storage
+	switch *storageFlag {
+	case "":
+		// no persistence
+	case "memory":
+		store = NewMemoryStorage(1000)
+	case "file":
+		s, err := NewFileStorage(*storageDir)
+		if err != nil {
+			log.Fatalf("Failed to open file storage at %s: %v", *storageDir, err)
+		}
+		store = s
+	default:
+		log.Fatalf("Unknown storage backend %q", *storageFlag)
+	}
+
+	if len(*authFlag) > 0 {
+		a, err := loadACLFile(*authFlag)
+		if err != nil {
+			log.Fatalf("Failed to load auth config %s: %v", *authFlag, err)
+		}
+		auth = a
+	}
+
+	mqClient, err := client.New(client.WithServers(strings.Split(*servers, ",")...))
+	if err != nil {
+		log.Fatalf("Failed to create mq client: %v", err)
 	}
 
 	defaultMQ = &mq{
-		client: client.New(client.WithServers(strings.Split(*servers, ",")...)),
-		topics: make(map[string][]chan []byte),
+		client:      mqClient,
+		cluster:     cluster,
+		store:       store,
+		topics:      make(map[string][]*subscription),
+		patterns:    make(map[string][]*subscription),
+		clusterSubs: make(map[<-chan *delivery]broker.Subscriber),
+		stats:       make(map[string]*dropCounters),
+	}
+
+	if store != nil {
+		go defaultMQ.sweep()
+	}
+}
+
+// sweep periodically drops expired messages and garbage-collects topics
+// that have no subscribers and no unexpired retained messages.
+func (m *mq) sweep() {
+	t := time.NewTicker(*sweepInterval)
+	defer t.Stop()
+
+	for range t.C {
+		empty, err := m.store.Sweep()
+		if err != nil {
+			log.Printf("storage sweep error: %v", err)
+			continue
+		}
+
+		m.Lock()
+		for _, topic := range empty {
+			if len(m.topics[topic]) == 0 {
+				delete(m.topics, topic)
+			}
+		}
+		m.Unlock()
 	}
 }
 
+// statsFor returns the drop counters for topic, creating them on first
+// use. Ephemeral RPC inbox topics aren't tracked, the same way pub skips
+// storage for them: every Request call mints a brand-new _inbox.<id>
+// topic, and keeping one dropCounters entry per request forever would
+// leak memory without bound.
+func (m *mq) statsFor(topic string) *dropCounters {
+	if strings.HasPrefix(topic, inboxPrefix) {
+		return newDropCounters()
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	d, ok := m.stats[topic]
+	if !ok {
+		d = newDropCounters()
+		m.stats[topic] = d
+	}
+	return d
+}
+
 func Log(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s %s", r.RemoteAddr, r.Method, r.URL)
@@ -49,57 +174,183 @@ func Log(handler http.Handler) http.Handler {
 	})
 }
 
-func (m *mq) pub(topic string, payload []byte) error {
+// inboxPrefix marks ephemeral per-subscriber reply topics used by the RPC
+// layer. Messages on these topics are routed directly to the single
+// subscriber that registered them rather than broadcast to every exact and
+// pattern match, and are never persisted.
+const inboxPrefix = "_inbox."
+
+func (m *mq) pub(topic string, payload []byte, ttl time.Duration) error {
 	if *proxy {
+		if m.cluster != nil {
+			return m.cluster.Publish(topic, payload)
+		}
 		return m.client.Publish(topic, payload)
 	}
 
+	isInbox := strings.HasPrefix(topic, inboxPrefix)
+
+	var storageID uint64
+	var hasID bool
+	if m.store != nil && !isInbox {
+		msg, err := m.store.Append(topic, payload, ttl)
+		if err != nil {
+			return err
+		}
+		storageID, hasID = msg.ID, true
+	}
+
 	m.RLock()
-	subscribers, ok := m.topics[topic]
+	subscribers := m.topics[topic]
+	if isInbox && len(subscribers) > 1 {
+		subscribers = subscribers[:1]
+	}
+	var patternSubscribers []*subscription
+	if !isInbox {
+		for pattern, subs := range m.patterns {
+			if matchPattern(pattern, topic) {
+				patternSubscribers = append(patternSubscribers, subs...)
+			}
+		}
+	}
 	m.RUnlock()
-	if !ok {
+
+	if len(subscribers) == 0 && len(patternSubscribers) == 0 {
 		return nil
 	}
 
 	go func() {
-		for _, subscriber := range subscribers {
-			select {
-			case subscriber <- payload:
-			default:
+		d := &delivery{topic: topic, payload: payload, storageID: storageID, hasID: hasID}
+
+		var dead []*subscription
+		for _, sub := range subscribers {
+			if !sub.send(d) {
+				dead = append(dead, sub)
 			}
 		}
+		for _, sub := range patternSubscribers {
+			if !sub.send(d) {
+				dead = append(dead, sub)
+			}
+		}
+
+		// A subscription reports dead when its PolicyBlock timeout elapsed
+		// or it was already closed; mark it closed so the /sub handler
+		// disconnects it.
+		// close is sync.Once-guarded, so concurrent publishers racing to
+		// report the same dead subscription can't double-close it.
+		for _, sub := range dead {
+			sub.close()
+			go m.unsub(sub.topic, sub)
+		}
 	}()
 
 	return nil
 }
 
-func (m *mq) sub(topic string) (<-chan []byte, error) {
+// sub subscribes to topic, which may be an exact topic name or a wildcard
+// pattern (e.g. "foo.*", "foo.#", "foo.+.bar"), applying policy (and, for
+// PolicyBlock, timeout) to deliveries that would otherwise overflow the
+// subscription's buffer. In proxy mode policy and timeout are ignored:
+// deliveries that would overflow are always dropped as drop_newest.
+func (m *mq) sub(topic string, policy DeliveryPolicy, timeout time.Duration) (*subscription, error) {
 	if *proxy {
-		return m.client.Subscribe(topic)
+		// Proxy subscriptions aren't added to m.topics/m.patterns, so
+		// they never surface through /stats, and unsub's proxy branch
+		// has nothing of its own to reclaim them by; statsFor's m.stats
+		// entry would just leak. Give each its own throwaway counters
+		// instead of tracking them in m.stats at all.
+		drops := newDropCounters()
+		sub := newSubscription(topic, PolicyDropNewest, 0, drops)
+
+		if m.cluster != nil {
+			clusterSub, err := m.cluster.Subscribe(topic, func(topic string, payload []byte) {
+				select {
+				case sub.ch <- &delivery{topic: topic, payload: payload}:
+				default:
+					drops.inc(PolicyDropNewest)
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+			m.Lock()
+			m.clusterSubs[sub.ch] = clusterSub
+			m.Unlock()
+			return sub, nil
+		}
+
+		msgs, err := m.client.SubscribeWithMeta(topic)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			for msg := range msgs {
+				select {
+				case sub.ch <- &delivery{topic: msg.Topic, payload: msg.Payload}:
+				default:
+					drops.inc(PolicyDropNewest)
+				}
+			}
+			close(sub.ch)
+		}()
+		return sub, nil
 	}
 
-	ch := make(chan []byte, 100)
+	drops := m.statsFor(topic)
+	sub := newSubscription(topic, policy, timeout, drops)
+
 	m.Lock()
-	m.topics[topic] = append(m.topics[topic], ch)
+	if isPattern(topic) {
+		m.patterns[topic] = append(m.patterns[topic], sub)
+	} else {
+		m.topics[topic] = append(m.topics[topic], sub)
+	}
 	m.Unlock()
-	return ch, nil
+
+	return sub, nil
 }
 
-func (m *mq) unsub(topic string, sub <-chan []byte) error {
+// replay returns retained messages for topic matching offset and since,
+// used to catch up subscribers before they join live fan-out.
+func (m *mq) replay(topic string, offset uint64, since time.Time) ([]*StoredMessage, error) {
+	if m.store == nil {
+		return nil, nil
+	}
+	return m.store.Replay(topic, offset, since)
+}
+
+func (m *mq) unsub(topic string, sub *subscription) error {
 	if *proxy {
-		// noop
-		return nil
+		if m.cluster == nil {
+			return nil
+		}
+
+		m.Lock()
+		clusterSub, ok := m.clusterSubs[sub.ch]
+		delete(m.clusterSubs, sub.ch)
+		m.Unlock()
+
+		if !ok {
+			return nil
+		}
+		return m.cluster.Unsubscribe(clusterSub)
+	}
+
+	registry := m.topics
+	if isPattern(topic) {
+		registry = m.patterns
 	}
 
 	m.RLock()
-	subscribers, ok := m.topics[topic]
+	subscribers, ok := registry[topic]
 	m.RUnlock()
 
 	if !ok {
 		return nil
 	}
 
-	var subs []chan []byte
+	var subs []*subscription
 	for _, subscriber := range subscribers {
 		if subscriber == sub {
 			continue
@@ -108,7 +359,12 @@ func (m *mq) unsub(topic string, sub <-chan []byte) error {
 	}
 
 	m.Lock()
-	m.topics[topic] = subs
+	if len(subs) == 0 {
+		delete(registry, topic)
+		delete(m.stats, topic)
+	} else {
+		registry[topic] = subs
+	}
 	m.Unlock()
 
 	return nil
@@ -116,6 +372,10 @@ func (m *mq) unsub(topic string, sub <-chan []byte) error {
 
 func pub(w http.ResponseWriter, r *http.Request) {
 	topic := r.URL.Query().Get("topic")
+	if !authorize(w, r, "pub", topic) {
+		return
+	}
+
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "Pub error", http.StatusInternalServerError)
@@ -123,7 +383,17 @@ func pub(w http.ResponseWriter, r *http.Request) {
 	}
 	r.Body.Close()
 
-	err = defaultMQ.pub(topic, b)
+	ttl := defaultTTL
+	if s := r.URL.Query().Get("ttl"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	err = defaultMQ.pub(topic, b, ttl)
 	if err != nil {
 		http.Error(w, "Pub error", http.StatusInternalServerError)
 		return
@@ -131,37 +401,281 @@ func pub(w http.ResponseWriter, r *http.Request) {
 }
 
 func sub(w http.ResponseWriter, r *http.Request) {
+	topic := r.URL.Query().Get("topic")
+	if !authorize(w, r, "sub", topic) {
+		return
+	}
+
 	conn, err := websocket.Upgrade(w, r, w.Header(), 1024, 1024)
 	if err != nil {
 		log.Println("Failed to open websocket connection")
 		http.Error(w, "Could not open websocket connection", http.StatusBadRequest)
 		return
 	}
+	defer conn.Close()
 
-	topic := r.URL.Query().Get("topic")
-	ch, err := defaultMQ.sub(topic)
+	policy := parseDeliveryPolicy(r.URL.Query().Get("policy"))
+
+	timeout := defaultBlockTimeout
+	if s := r.URL.Query().Get("timeout"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	var offset uint64
+	if s := r.URL.Query().Get("offset"); len(s) > 0 {
+		offset, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+
+	// ack=1 opts into at-least-once delivery: every message on this
+	// connection gets a sequence number and is redelivered until acked.
+	// For an exact, storage-backed topic the tracker uses the message's
+	// storage ID as its seq (see newAckTracker), so seqs stay meaningful
+	// across reconnects and resume, below, can feed a previously-seen seq
+	// straight back in as the replay offset. Pattern subscriptions and
+	// topics without storage fall back to a connection-local counter, so
+	// resume is only useful on exact, storage-backed topics.
+	ackMode := r.URL.Query().Get("ack") == "1"
+
+	ackTimeout := defaultAckTimeout
+	if s := r.URL.Query().Get("ack_timeout"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			http.Error(w, "Invalid ack_timeout", http.StatusBadRequest)
+			return
+		}
+		ackTimeout = d
+	}
+
+	var resume uint64
+	if s := r.URL.Query().Get("resume"); len(s) > 0 {
+		resume, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid resume", http.StatusBadRequest)
+			return
+		}
+		if offset == 0 {
+			offset = resume
+		}
+	}
+
+	// Replay retained messages before joining live fan-out so a late
+	// subscriber doesn't miss anything already delivered to others. Only
+	// exact topics are backed by storage; patterns have nothing to replay.
+	var backlog []*StoredMessage
+	if !isPattern(topic) {
+		backlog, err = defaultMQ.replay(topic, offset, since)
+		if err != nil {
+			log.Printf("Failed to replay %s topic: %v", topic, err)
+			http.Error(w, "Could not replay events", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	sub, err := defaultMQ.sub(topic, policy, timeout)
 	if err != nil {
 		log.Printf("Failed to retrieve event for %s topic", topic)
 		http.Error(w, "Could not retrieve events", http.StatusInternalServerError)
 		return
 	}
-	defer defaultMQ.unsub(topic, ch)
+	defer defaultMQ.unsub(topic, sub)
+
+	var writeMu sync.Mutex
+
+	var tracker *ackTracker
+	if ackMode {
+		// Only an exact, storage-backed topic has a stable per-message ID
+		// that survives reconnects; everything else gets a counter scoped
+		// to this connection.
+		useStorageSeq := !isPattern(topic) && defaultMQ.store != nil
+		tracker = newAckTracker(ackTimeout, useStorageSeq)
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			for {
+				t, p, err := conn.ReadMessage()
+				if err != nil || t == websocket.CloseMessage {
+					return
+				}
+				typ, seq, err := decodeAckControl(p)
+				if err != nil {
+					continue
+				}
+				switch typ {
+				case ackFrame:
+					tracker.ack(seq)
+				case nackFrame:
+					tracker.nack(seq)
+				}
+			}
+		}()
+
+		redeliverEvery := ackTimeout / 4
+		if redeliverEvery < time.Second {
+			redeliverEvery = time.Second
+		}
+
+		go func() {
+			t := time.NewTicker(redeliverEvery)
+			defer t.Stop()
+
+			for {
+				select {
+				case <-t.C:
+					for _, rd := range tracker.due() {
+						writeMu.Lock()
+						err := conn.WriteMessage(websocket.BinaryMessage, encodeAckEnvelope(rd.seq, rd.delivery.topic, rd.delivery.payload))
+						writeMu.Unlock()
+						if err != nil {
+							return
+						}
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	for _, msg := range backlog {
+		var frame []byte
+		if ackMode {
+			d := &delivery{topic: topic, payload: msg.Payload, storageID: msg.ID, hasID: true}
+			seq, overflow := tracker.track(d)
+			if overflow {
+				log.Printf("disconnecting %s subscriber: too many unacked messages", topic)
+				return
+			}
+			frame = encodeAckEnvelope(seq, topic, msg.Payload)
+		} else {
+			frame = envelope.Encode(topic, msg.Payload)
+		}
+
+		writeMu.Lock()
+		err = conn.WriteMessage(websocket.BinaryMessage, frame)
+		writeMu.Unlock()
+		if err != nil {
+			log.Printf("error sending replayed event: %v", err.Error())
+			return
+		}
+	}
 
 	for {
+		// Prefer a buffered message over done so a subscription marked
+		// dead while messages were still queued drains them first,
+		// matching the old close(sub.ch)-drains-before-!ok behaviour.
+		var e *delivery
 		select {
-		case e := <-ch:
-			if err = conn.WriteMessage(websocket.BinaryMessage, e); err != nil {
-				log.Printf("error sending event: %v", err.Error())
+		case e = <-sub.ch:
+		default:
+			select {
+			case e = <-sub.ch:
+			case <-sub.done:
+				// The subscriber was disconnected, e.g. a PolicyBlock timeout.
 				return
 			}
 		}
+
+		e = sub.resolve(e)
+
+		var frame []byte
+		if ackMode {
+			seq, overflow := tracker.track(e)
+			if overflow {
+				log.Printf("disconnecting %s subscriber: too many unacked messages", topic)
+				return
+			}
+			frame = encodeAckEnvelope(seq, e.topic, e.payload)
+		} else {
+			frame = envelope.Encode(e.topic, e.payload)
+		}
+
+		writeMu.Lock()
+		err = conn.WriteMessage(websocket.BinaryMessage, frame)
+		writeMu.Unlock()
+		if err != nil {
+			log.Printf("error sending event: %v", err.Error())
+			return
+		}
+	}
+}
+
+// topicStats is the /stats JSON representation of one topic or pattern's
+// subscriber counts, buffered depth, and drop counts per policy.
+type topicStats struct {
+	Topic       string            `json:"topic"`
+	Subscribers int               `json:"subscribers"`
+	Buffered    int               `json:"buffered"`
+	Drops       map[string]uint64 `json:"drops"`
+}
+
+func stats(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, "stats", "") {
+		return
+	}
+
+	defaultMQ.RLock()
+	subsByTopic := make(map[string][]*subscription, len(defaultMQ.topics)+len(defaultMQ.patterns))
+	for topic, subs := range defaultMQ.topics {
+		subsByTopic[topic] = append(subsByTopic[topic], subs...)
+	}
+	for topic, subs := range defaultMQ.patterns {
+		subsByTopic[topic] = append(subsByTopic[topic], subs...)
+	}
+	dropsByTopic := make(map[string]*dropCounters, len(defaultMQ.stats))
+	for topic, d := range defaultMQ.stats {
+		dropsByTopic[topic] = d
+	}
+	defaultMQ.RUnlock()
+
+	out := make([]topicStats, 0, len(subsByTopic))
+	for topic, subs := range subsByTopic {
+		st := topicStats{Topic: topic, Subscribers: len(subs), Drops: map[string]uint64{}}
+		for _, sub := range subs {
+			st.Buffered += len(sub.ch)
+		}
+		if d, ok := dropsByTopic[topic]; ok {
+			for policy, count := range d.snapshot() {
+				st.Drops[string(policy)] = count
+			}
+		}
+		out = append(out, st)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, "Stats error", http.StatusInternalServerError)
 	}
 }
 
 func main() {
+	flag.Parse()
+	setup()
+
 	// MQ Handlers
 	http.HandleFunc("/pub", pub)
 	http.HandleFunc("/sub", sub)
+	http.HandleFunc("/stats", stats)
 
 	if len(*cert) > 0 && len(*key) > 0 {
 		log.Println("TLS Enabled")
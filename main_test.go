@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/asim/mq/go/broker"
+)
+
+func newTestMQ() *mq {
+	return &mq{
+		topics:      make(map[string][]*subscription),
+		patterns:    make(map[string][]*subscription),
+		clusterSubs: make(map[<-chan *delivery]broker.Subscriber),
+		stats:       make(map[string]*dropCounters),
+	}
+}
+
+func TestStatsCleanedUpOnUnsubscribe(t *testing.T) {
+	m := newTestMQ()
+
+	for i := 0; i < 50; i++ {
+		topic := fmt.Sprintf("real.%d", i)
+		sub, err := m.sub(topic, PolicyDropNewest, 0)
+		if err != nil {
+			t.Fatalf("sub(%q): %v", topic, err)
+		}
+		if err := m.unsub(topic, sub); err != nil {
+			t.Fatalf("unsub(%q): %v", topic, err)
+		}
+	}
+
+	if len(m.stats) != 0 {
+		t.Errorf("m.stats retained %d entries after every subscriber left", len(m.stats))
+	}
+	if len(m.topics) != 0 {
+		t.Errorf("m.topics retained %d entries after every subscriber left", len(m.topics))
+	}
+}
+
+func TestInboxTopicsDontAccumulateStats(t *testing.T) {
+	m := newTestMQ()
+
+	for i := 0; i < 100; i++ {
+		topic := fmt.Sprintf("%s%d", inboxPrefix, i)
+		sub, err := m.sub(topic, PolicyDropNewest, 0)
+		if err != nil {
+			t.Fatalf("sub(%q): %v", topic, err)
+		}
+		if err := m.unsub(topic, sub); err != nil {
+			t.Fatalf("unsub(%q): %v", topic, err)
+		}
+	}
+
+	if len(m.stats) != 0 {
+		t.Errorf("m.stats has %d entries, want 0 for inbox-only topics", len(m.stats))
+	}
+}
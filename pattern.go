@@ -0,0 +1,73 @@
+package main
+
+import "strings"
+
+// isPattern reports whether topic contains a wildcard token and therefore
+// belongs in the pattern subscriber registry rather than the exact-match
+// topics map.
+func isPattern(topic string) bool {
+	return strings.ContainsAny(topic, "*#+")
+}
+
+// matchPattern reports whether topic matches pattern. Patterns are
+// '.'-separated, NATS-style: "*" matches exactly one token, "#" matches
+// one or more trailing tokens and must be the last token in the pattern.
+// MQTT-style "+" is accepted as a synonym for "*".
+func matchPattern(pattern, topic string) bool {
+	pTokens := strings.Split(pattern, ".")
+	tTokens := strings.Split(topic, ".")
+
+	for i, p := range pTokens {
+		if p == "#" {
+			return i < len(tTokens)
+		}
+		if i >= len(tTokens) {
+			return false
+		}
+		if p == "*" || p == "+" {
+			continue
+		}
+		if p != tTokens[i] {
+			return false
+		}
+	}
+
+	return len(pTokens) == len(tTokens)
+}
+
+// patternContains reports whether every concrete topic matchPattern would
+// ever match against requested is also matched by acl. It's the check an
+// ACL needs when the caller's requested topic is itself a wildcard
+// pattern (e.g. a subscribe for "foo.#"): acl only authorizes requested if
+// acl's match set is a superset of requested's, not merely if acl matches
+// requested's literal token string.
+func patternContains(acl, requested string) bool {
+	aTokens := strings.Split(acl, ".")
+	rTokens := strings.Split(requested, ".")
+
+	for i, a := range aTokens {
+		if a == "#" {
+			return i < len(rTokens)
+		}
+		if i >= len(rTokens) {
+			return false
+		}
+		r := rTokens[i]
+		switch a {
+		case "*", "+":
+			// A single-token wildcard in acl only covers requested's
+			// token if that token is itself pinned to exactly one
+			// level; "#" there could match multiple, which acl never
+			// granted.
+			if r == "#" {
+				return false
+			}
+		default:
+			if r != a {
+				return false
+			}
+		}
+	}
+
+	return len(aTokens) == len(rTokens)
+}
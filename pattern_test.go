@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestIsPattern(t *testing.T) {
+	cases := map[string]bool{
+		"foo.bar":   false,
+		"foo.*":     true,
+		"foo.#":     true,
+		"foo.+.bar": true,
+	}
+	for topic, want := range cases {
+		if got := isPattern(topic); got != want {
+			t.Errorf("isPattern(%q) = %v, want %v", topic, got, want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"foo.bar", "foo.bar", true},
+		{"foo.bar", "foo.baz", false},
+		{"foo.*", "foo.bar", true},
+		{"foo.*", "foo.bar.baz", false},
+		{"foo.+", "foo.bar", true},
+		{"foo.#", "foo.bar", true},
+		{"foo.#", "foo.bar.baz", true},
+		{"foo.#", "foo", false},
+		{"*.bar", "foo.bar", true},
+		{"*.bar", "foo.baz", false},
+	}
+
+	for _, c := range cases {
+		if got := matchPattern(c.pattern, c.topic); got != c.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", c.pattern, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestPatternContains(t *testing.T) {
+	cases := []struct {
+		acl, requested string
+		want           bool
+	}{
+		// foo.# authorizes anything under foo, including a narrower
+		// wildcard subscription.
+		{"foo.#", "foo.*", true},
+		{"foo.#", "foo.bar", true},
+		// foo.* only ever matches a single token, so it can't
+		// authorize a subscribe for the broader foo.#.
+		{"foo.*", "foo.#", false},
+		// A single-level wildcard in the acl pattern only covers a
+		// same-shaped single-level wildcard in the request.
+		{"foo.*", "foo.*", true},
+		{"*.bar", "foo.*", false},
+		{"foo.bar", "foo.bar", true},
+		{"foo.bar", "foo.*", false},
+	}
+
+	for _, c := range cases {
+		if got := patternContains(c.acl, c.requested); got != c.want {
+			t.Errorf("patternContains(%q, %q) = %v, want %v", c.acl, c.requested, got, c.want)
+		}
+	}
+}
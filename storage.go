@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTTL is how long a message is retained when a publisher does not
+// override it via the ttl query param.
+const defaultTTL = 60 * time.Second
+
+// StoredMessage is a single retained message in a topic's durable log.
+type StoredMessage struct {
+	ID        uint64    `json:"id"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (m *StoredMessage) expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && now.After(m.ExpiresAt)
+}
+
+// Storage is the interface a persistent topic log backend must implement.
+// Implementations are responsible for assigning monotonically increasing
+// per-topic message IDs and for honouring per-message TTLs.
+type Storage interface {
+	// Append stores payload under topic with the given ttl and returns the
+	// message it was stored as.
+	Append(topic string, payload []byte, ttl time.Duration) (*StoredMessage, error)
+
+	// Replay returns retained, unexpired messages for topic with an ID
+	// greater than offset and a CreatedAt after since. Either filter may be
+	// zero to mean "no filter".
+	Replay(topic string, offset uint64, since time.Time) ([]*StoredMessage, error)
+
+	// Sweep drops expired messages across all topics and returns the names
+	// of topics left with no retained messages.
+	Sweep() ([]string, error)
+
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// memoryStorage is a ring-buffer backed Storage. Each topic keeps up to
+// maxPerTopic messages; older messages fall off the ring regardless of TTL.
+type memoryStorage struct {
+	maxPerTopic int
+
+	sync.Mutex
+	topics map[string][]*StoredMessage
+	nextID map[string]uint64
+}
+
+// NewMemoryStorage returns an in-memory ring buffer Storage retaining up to
+// maxPerTopic messages per topic.
+func NewMemoryStorage(maxPerTopic int) Storage {
+	return &memoryStorage{
+		maxPerTopic: maxPerTopic,
+		topics:      make(map[string][]*StoredMessage),
+		nextID:      make(map[string]uint64),
+	}
+}
+
+func (s *memoryStorage) Append(topic string, payload []byte, ttl time.Duration) (*StoredMessage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.nextID[topic]++
+	msg := &StoredMessage{
+		ID:        s.nextID[topic],
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		msg.ExpiresAt = msg.CreatedAt.Add(ttl)
+	}
+
+	msgs := append(s.topics[topic], msg)
+	if s.maxPerTopic > 0 && len(msgs) > s.maxPerTopic {
+		msgs = msgs[len(msgs)-s.maxPerTopic:]
+	}
+	s.topics[topic] = msgs
+
+	return msg, nil
+}
+
+func (s *memoryStorage) Replay(topic string, offset uint64, since time.Time) ([]*StoredMessage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	var out []*StoredMessage
+	for _, msg := range s.topics[topic] {
+		if msg.expired(now) {
+			continue
+		}
+		if msg.ID <= offset {
+			continue
+		}
+		if !since.IsZero() && msg.CreatedAt.Before(since) {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+func (s *memoryStorage) Sweep() ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	var empty []string
+	for topic, msgs := range s.topics {
+		var live []*StoredMessage
+		for _, msg := range msgs {
+			if !msg.expired(now) {
+				live = append(live, msg)
+			}
+		}
+		if len(live) == 0 {
+			delete(s.topics, topic)
+			empty = append(empty, topic)
+			continue
+		}
+		s.topics[topic] = live
+	}
+	return empty, nil
+}
+
+func (s *memoryStorage) Close() error {
+	return nil
+}
+
+// fileStorage persists each topic as a newline-delimited JSON log under dir.
+// It keeps the same in-memory index as memoryStorage so reads don't hit
+// disk, but every Append is fsynced before it is acknowledged.
+type fileStorage struct {
+	dir string
+
+	sync.Mutex
+	topics map[string][]*StoredMessage
+	nextID map[string]uint64
+	files  map[string]*os.File
+}
+
+// NewFileStorage returns a Storage backend that appends each topic's
+// messages to its own file under dir, one JSON object per line.
+func NewFileStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &fileStorage{
+		dir:    dir,
+		topics: make(map[string][]*StoredMessage),
+		nextID: make(map[string]uint64),
+		files:  make(map[string]*os.File),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		topic := entry.Name()
+		if err := s.load(topic); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *fileStorage) load(topic string) error {
+	f, err := os.OpenFile(s.path(topic), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.files[topic] = f
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg StoredMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return fmt.Errorf("corrupt entry in %s: %w", s.path(topic), err)
+		}
+		s.topics[topic] = append(s.topics[topic], &msg)
+		if msg.ID > s.nextID[topic] {
+			s.nextID[topic] = msg.ID
+		}
+	}
+	return scanner.Err()
+}
+
+// safeTopicFilename reports whether topic is safe to use verbatim as a
+// file name under s.dir. Topics come straight from the caller-supplied
+// ?topic= query param, so anything containing a path separator or a ".."
+// segment is rejected to keep a publish from writing outside dir.
+func safeTopicFilename(topic string) bool {
+	if len(topic) == 0 || topic == "." || topic == ".." {
+		return false
+	}
+	return !strings.ContainsAny(topic, `/\`)
+}
+
+func (s *fileStorage) path(topic string) string {
+	return filepath.Join(s.dir, topic)
+}
+
+func (s *fileStorage) Append(topic string, payload []byte, ttl time.Duration) (*StoredMessage, error) {
+	if !safeTopicFilename(topic) {
+		return nil, fmt.Errorf("storage: invalid topic %q", topic)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	f, ok := s.files[topic]
+	if !ok {
+		if err := s.load(topic); err != nil {
+			return nil, err
+		}
+		f = s.files[topic]
+	}
+
+	s.nextID[topic]++
+	msg := &StoredMessage{
+		ID:        s.nextID[topic],
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		msg.ExpiresAt = msg.CreatedAt.Add(ttl)
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+
+	s.topics[topic] = append(s.topics[topic], msg)
+	return msg, nil
+}
+
+func (s *fileStorage) Replay(topic string, offset uint64, since time.Time) ([]*StoredMessage, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	var out []*StoredMessage
+	for _, msg := range s.topics[topic] {
+		if msg.expired(now) {
+			continue
+		}
+		if msg.ID <= offset {
+			continue
+		}
+		if !since.IsZero() && msg.CreatedAt.Before(since) {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+func (s *fileStorage) Sweep() ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	var empty []string
+	for topic, msgs := range s.topics {
+		var live []*StoredMessage
+		for _, msg := range msgs {
+			if !msg.expired(now) {
+				live = append(live, msg)
+			}
+		}
+		s.topics[topic] = live
+		if len(live) == 0 {
+			delete(s.topics, topic)
+			empty = append(empty, topic)
+			if f, ok := s.files[topic]; ok {
+				f.Close()
+				os.Remove(s.path(topic))
+				delete(s.files, topic)
+			}
+		}
+	}
+	return empty, nil
+}
+
+func (s *fileStorage) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	var ferr error
+	for _, f := range s.files {
+		if err := f.Close(); err != nil {
+			ferr = err
+		}
+	}
+	return ferr
+}
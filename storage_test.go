@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestSafeTopicFilename(t *testing.T) {
+	cases := []struct {
+		topic string
+		want  bool
+	}{
+		{"orders", true},
+		{"orders.created", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../../etc/cron.d/evil", false},
+		{"foo/../bar", false},
+		{"foo\\bar", false},
+		{"/etc/passwd", false},
+	}
+
+	for _, c := range cases {
+		if got := safeTopicFilename(c.topic); got != c.want {
+			t.Errorf("safeTopicFilename(%q) = %v, want %v", c.topic, got, c.want)
+		}
+	}
+}
+
+func TestFileStorageAppendRejectsTraversal(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.Append("../../etc/cron.d/evil", []byte("pwned"), 0); err == nil {
+		t.Fatal("Append with a path-traversal topic should have failed")
+	}
+}
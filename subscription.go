@@ -0,0 +1,219 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// DeliveryPolicy controls what happens when a subscriber's inbound queue
+// is full instead of always silently dropping the message.
+type DeliveryPolicy string
+
+const (
+	// PolicyDropNewest discards the message being delivered. This is the
+	// original, and still the default, mq behaviour.
+	PolicyDropNewest DeliveryPolicy = "drop_newest"
+	// PolicyDropOldest evicts the oldest buffered message to make room
+	// for the new one.
+	PolicyDropOldest DeliveryPolicy = "drop_oldest"
+	// PolicyBlock waits up to the subscription's timeout for room,
+	// disconnecting the subscriber if it never arrives.
+	PolicyBlock DeliveryPolicy = "block"
+	// PolicyCoalesce keeps only the latest message for a key derived
+	// from the first few bytes of the payload, useful for state updates
+	// where only the newest value matters.
+	PolicyCoalesce DeliveryPolicy = "coalesce"
+)
+
+const (
+	subscriptionBufferSize = 100
+	defaultBlockTimeout    = 5 * time.Second
+	coalesceKeyLen         = 8
+)
+
+// parseDeliveryPolicy maps a `?policy=` query param to a DeliveryPolicy,
+// defaulting to PolicyDropNewest for an empty or unrecognised value.
+func parseDeliveryPolicy(s string) DeliveryPolicy {
+	switch DeliveryPolicy(s) {
+	case PolicyDropOldest, PolicyBlock, PolicyCoalesce:
+		return DeliveryPolicy(s)
+	default:
+		return PolicyDropNewest
+	}
+}
+
+// dropCounters tracks how many messages a topic has dropped, broken down
+// by delivery policy, for the /stats endpoint.
+type dropCounters struct {
+	sync.Mutex
+	counts map[DeliveryPolicy]uint64
+}
+
+func newDropCounters() *dropCounters {
+	return &dropCounters{counts: make(map[DeliveryPolicy]uint64)}
+}
+
+func (d *dropCounters) inc(policy DeliveryPolicy) {
+	d.Lock()
+	d.counts[policy]++
+	d.Unlock()
+}
+
+func (d *dropCounters) snapshot() map[DeliveryPolicy]uint64 {
+	d.Lock()
+	defer d.Unlock()
+
+	out := make(map[DeliveryPolicy]uint64, len(d.counts))
+	for k, v := range d.counts {
+		out[k] = v
+	}
+	return out
+}
+
+// subscription is one subscriber's inbound queue for a topic or pattern.
+// pub delivers into it via send, which applies the subscription's
+// DeliveryPolicy, and the /sub handler drains it via ch, calling resolve
+// on whatever it receives.
+type subscription struct {
+	topic   string
+	policy  DeliveryPolicy
+	timeout time.Duration
+	ch      chan *delivery
+	done    chan struct{}
+	drops   *dropCounters
+
+	closeOnce sync.Once
+
+	sync.Mutex
+	queued    map[string]bool
+	coalesced map[string]*delivery
+}
+
+// newSubscription returns a subscription to topic using policy, ready to
+// have messages delivered into it via send.
+func newSubscription(topic string, policy DeliveryPolicy, timeout time.Duration, drops *dropCounters) *subscription {
+	if timeout <= 0 {
+		timeout = defaultBlockTimeout
+	}
+	return &subscription{
+		topic:     topic,
+		policy:    policy,
+		timeout:   timeout,
+		ch:        make(chan *delivery, subscriptionBufferSize),
+		done:      make(chan struct{}),
+		drops:     drops,
+		queued:    make(map[string]bool),
+		coalesced: make(map[string]*delivery),
+	}
+}
+
+// close marks s dead: send stops delivering into s.ch and the /sub handler
+// reading it returns. Safe to call more than once or from more than one
+// publishing goroutine concurrently — only the first call has any effect.
+func (s *subscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// send delivers d according to the subscription's policy. It returns
+// false if the subscriber should be disconnected, which only happens for
+// PolicyBlock once its timeout elapses or the subscription has already
+// been closed (e.g. by a concurrent publish's PolicyBlock timeout).
+func (s *subscription) send(d *delivery) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	switch s.policy {
+	case PolicyBlock:
+		select {
+		case s.ch <- d:
+			return true
+		case <-s.done:
+			return false
+		case <-time.After(s.timeout):
+			s.drops.inc(s.policy)
+			return false
+		}
+
+	case PolicyDropOldest:
+		select {
+		case s.ch <- d:
+			return true
+		default:
+		}
+		select {
+		case <-s.ch:
+			s.drops.inc(s.policy)
+		default:
+		}
+		select {
+		case s.ch <- d:
+		default:
+		}
+		return true
+
+	case PolicyCoalesce:
+		key := coalesceKey(d.payload)
+
+		s.Lock()
+		if s.queued[key] {
+			s.coalesced[key] = d
+			s.Unlock()
+			return true
+		}
+		s.queued[key] = true
+		s.Unlock()
+
+		select {
+		case s.ch <- d:
+		default:
+			s.Lock()
+			delete(s.queued, key)
+			s.Unlock()
+			s.drops.inc(s.policy)
+		}
+		return true
+
+	default: // PolicyDropNewest
+		select {
+		case s.ch <- d:
+		default:
+			s.drops.inc(s.policy)
+		}
+		return true
+	}
+}
+
+// resolve is called by the consumer right after receiving d from s.ch.
+// For PolicyCoalesce it swaps in whatever value most recently replaced
+// d's key while d was still buffered; every other policy returns d as-is.
+func (s *subscription) resolve(d *delivery) *delivery {
+	if s.policy != PolicyCoalesce {
+		return d
+	}
+
+	key := coalesceKey(d.payload)
+
+	s.Lock()
+	defer s.Unlock()
+
+	latest, ok := s.coalesced[key]
+	delete(s.queued, key)
+	delete(s.coalesced, key)
+	if ok {
+		return latest
+	}
+	return d
+}
+
+func coalesceKey(payload []byte) string {
+	n := coalesceKeyLen
+	if len(payload) < n {
+		n = len(payload)
+	}
+	return string(payload[:n])
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestParseDeliveryPolicy(t *testing.T) {
+	cases := map[string]DeliveryPolicy{
+		"":            PolicyDropNewest,
+		"drop_newest": PolicyDropNewest,
+		"drop_oldest": PolicyDropOldest,
+		"block":       PolicyBlock,
+		"coalesce":    PolicyCoalesce,
+		"bogus":       PolicyDropNewest,
+	}
+	for s, want := range cases {
+		if got := parseDeliveryPolicy(s); got != want {
+			t.Errorf("parseDeliveryPolicy(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestSubscriptionDropNewest(t *testing.T) {
+	drops := newDropCounters()
+	sub := newSubscription("foo", PolicyDropNewest, 0, drops)
+
+	for i := 0; i < subscriptionBufferSize+1; i++ {
+		sub.send(&delivery{topic: "foo", payload: []byte("x")})
+	}
+
+	if got := drops.snapshot()[PolicyDropNewest]; got != 1 {
+		t.Errorf("drops = %d, want 1", got)
+	}
+	if len(sub.ch) != subscriptionBufferSize {
+		t.Errorf("buffered = %d, want %d", len(sub.ch), subscriptionBufferSize)
+	}
+}
+
+func TestSubscriptionDropOldestEvictsOldest(t *testing.T) {
+	drops := newDropCounters()
+	sub := newSubscription("foo", PolicyDropOldest, 0, drops)
+
+	first := &delivery{topic: "foo", payload: []byte("first")}
+	sub.send(first)
+	for i := 0; i < subscriptionBufferSize; i++ {
+		sub.send(&delivery{topic: "foo", payload: []byte("x")})
+	}
+
+	got := <-sub.ch
+	if got == first {
+		t.Error("oldest message should have been evicted, not delivered first")
+	}
+	if drops.snapshot()[PolicyDropOldest] == 0 {
+		t.Error("expected at least one drop_oldest eviction to be counted")
+	}
+}
+
+// TestSubscriptionCloseConcurrent guards against the panic a sync.Once-less
+// close used to risk: several publishing goroutines all deciding the same
+// PolicyBlock subscription is dead and racing to close it.
+func TestSubscriptionCloseConcurrent(t *testing.T) {
+	drops := newDropCounters()
+	sub := newSubscription("foo", PolicyBlock, 0, drops)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub.close()
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-sub.done:
+	default:
+		t.Fatal("expected sub.done to be closed")
+	}
+}
+
+// TestSubscriptionSendAfterClose ensures a send that arrives after close
+// doesn't block waiting out PolicyBlock's timeout or panic on a closed
+// channel.
+func TestSubscriptionSendAfterClose(t *testing.T) {
+	drops := newDropCounters()
+	sub := newSubscription("foo", PolicyBlock, 0, drops)
+	sub.close()
+
+	if ok := sub.send(&delivery{topic: "foo", payload: []byte("x")}); ok {
+		t.Error("send on a closed subscription should report the subscriber as dead")
+	}
+}